@@ -0,0 +1,65 @@
+package endpoint
+
+import "sync"
+
+// numBufferPoolBuckets covers power-of-two bucket sizes from 1B up to 2^31 bytes,
+// which is far beyond any realistic single motan message.
+const numBufferPoolBuckets = 32
+
+// bufferPool is a sized-bucket []byte pool, modeled on libp2p's mpool.ByteSlicePool:
+// Get/Put are keyed by the power-of-two bucket a requested size falls into, so
+// buffers of the same rough size are recycled instead of allocated per request.
+type bufferPool struct {
+	buckets [numBufferPoolBuckets]sync.Pool
+}
+
+func newBufferPool() *bufferPool {
+	bp := &bufferPool{}
+	for i := range bp.buckets {
+		size := 1 << uint(i)
+		bp.buckets[i].New = func() interface{} {
+			return make([]byte, size)
+		}
+	}
+	return bp
+}
+
+// globalBufferPool is shared by every Channel of every endpoint in this process,
+// the same way a single connection pool's worth of traffic shares one allocator.
+var globalBufferPool = newBufferPool()
+
+func bufferPoolBucket(size uint32) int {
+	idx := 0
+	for bucketSize := uint32(1); bucketSize < size; bucketSize <<= 1 {
+		idx++
+		if bucketSize >= 1<<31 { // guard against overflow on the shift
+			break
+		}
+	}
+	return idx
+}
+
+// Get returns a []byte of exactly size bytes, reused from the matching bucket
+// when possible.
+func (bp *bufferPool) Get(size uint32) []byte {
+	idx := bufferPoolBucket(size)
+	if idx >= len(bp.buckets) {
+		return make([]byte, size)
+	}
+	buf := bp.buckets[idx].Get().([]byte)
+	return buf[:size]
+}
+
+// Put returns a buffer to the bucket matching size. buf need not have come
+// from Get -- e.g. Stream.Send hands back its already-allocated encode
+// buffer -- but its capacity must cover the bucket's nominal size (1<<idx),
+// since a later Get(size) will reslice whatever comes out of that bucket up
+// to size. A smaller buffer is dropped instead of stored, so it can never
+// cause a future Get to slice out of range.
+func (bp *bufferPool) Put(size uint32, buf []byte) {
+	idx := bufferPoolBucket(size)
+	if idx >= len(bp.buckets) || buf == nil || uint32(cap(buf)) < 1<<uint(idx) {
+		return
+	}
+	bp.buckets[idx].Put(buf[:cap(buf)])
+}
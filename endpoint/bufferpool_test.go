@@ -0,0 +1,64 @@
+package endpoint
+
+import "testing"
+
+func TestBufferPoolBucket(t *testing.T) {
+	cases := []struct {
+		size uint32
+		idx  int
+	}{
+		{0, 0},
+		{1, 0},
+		{2, 1},
+		{3, 2},
+		{4, 2},
+		{5, 3},
+		{100, 7},
+		{128, 7},
+		{129, 8},
+	}
+	for _, c := range cases {
+		if got := bufferPoolBucket(c.size); got != c.idx {
+			t.Errorf("bufferPoolBucket(%d) = %d, want %d", c.size, got, c.idx)
+		}
+	}
+}
+
+func TestBufferPoolGetSizedExactly(t *testing.T) {
+	bp := newBufferPool()
+	for _, size := range []uint32{1, 17, 64, 1000} {
+		buf := bp.Get(size)
+		if uint32(len(buf)) != size {
+			t.Fatalf("Get(%d) returned len %d", size, len(buf))
+		}
+	}
+}
+
+func TestBufferPoolPutGetReuse(t *testing.T) {
+	bp := newBufferPool()
+	buf := bp.Get(64)
+	buf[0] = 0x42
+	bp.Put(64, buf)
+	reused := bp.Get(64)
+	if &reused[0] != &buf[0] {
+		t.Fatalf("Get(64) after Put(64, buf) did not reuse the same backing array")
+	}
+}
+
+func TestBufferPoolPutDropsUndersizedBuffer(t *testing.T) {
+	bp := newBufferPool()
+	// A buffer whose capacity doesn't cover its bucket's nominal size (128 for
+	// bucket 7, since 100 falls in that bucket) must be dropped instead of
+	// stored, since a later Get(100ish) would reslice it past its capacity.
+	undersized := make([]byte, 100)
+	bp.Put(100, undersized)
+	got := bp.Get(100)
+	if &got[0] == &undersized[0] {
+		t.Fatalf("Put stored an undersized buffer that a later Get returned")
+	}
+}
+
+func TestBufferPoolPutNilIsNoop(t *testing.T) {
+	bp := newBufferPool()
+	bp.Put(64, nil)
+}
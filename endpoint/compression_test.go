@@ -0,0 +1,73 @@
+package endpoint
+
+import "testing"
+
+func newTestChannel(myOptions, peerOptions map[string]string) *Channel {
+	return &Channel{myOptions: myOptions, peerOptions: peerOptions}
+}
+
+func TestNegotiatedCompressorPicksSharedCompressor(t *testing.T) {
+	c := newTestChannel(
+		map[string]string{compressorsOptionKey: supportedCompressors},
+		map[string]string{compressorsOptionKey: "gzip,none"},
+	)
+	if got := c.NegotiatedCompressor(); got != "gzip" {
+		t.Fatalf("NegotiatedCompressor() = %q, want gzip", got)
+	}
+}
+
+func TestNegotiatedCompressorNoSharedCompressor(t *testing.T) {
+	c := newTestChannel(
+		map[string]string{compressorsOptionKey: supportedCompressors},
+		map[string]string{compressorsOptionKey: "snappy,none"},
+	)
+	if got := c.NegotiatedCompressor(); got != "none" {
+		t.Fatalf("NegotiatedCompressor() = %q, want none", got)
+	}
+}
+
+func TestNegotiatedCompressorNoHandshake(t *testing.T) {
+	c := newTestChannel(nil, nil)
+	if got := c.NegotiatedCompressor(); got != "none" {
+		t.Fatalf("NegotiatedCompressor() = %q, want none", got)
+	}
+}
+
+func TestGzipCompressDecompressRoundTrip(t *testing.T) {
+	body := []byte("the quick brown fox jumps over the lazy dog, repeated for compressibility: " +
+		"the quick brown fox jumps over the lazy dog")
+	compressed, err := gzipCompress(body)
+	if err != nil {
+		t.Fatalf("gzipCompress() error: %v", err)
+	}
+	if !isGzipCompressed(compressed) {
+		t.Fatalf("isGzipCompressed() = false for a freshly gzipped body")
+	}
+	decompressed, err := gzipDecompress(compressed)
+	if err != nil {
+		t.Fatalf("gzipDecompress() error: %v", err)
+	}
+	if string(decompressed) != string(body) {
+		t.Fatalf("round-trip mismatch: got %q, want %q", decompressed, body)
+	}
+}
+
+func TestIsGzipCompressedRejectsPlainBody(t *testing.T) {
+	if isGzipCompressed([]byte("not gzip")) {
+		t.Fatalf("isGzipCompressed() = true for a plain body")
+	}
+	if isGzipCompressed(nil) {
+		t.Fatalf("isGzipCompressed(nil) = true")
+	}
+}
+
+func TestCompressionStatsRecord(t *testing.T) {
+	var stats compressionStats
+	stats.recordOut(100, 40)
+	stats.recordIn(80, 30)
+	gotOutRaw, gotOutCompressed, gotInRaw, gotInCompressed := (&MotanEndpoint{compression: stats}).CompressionStats()
+	if gotOutRaw != 100 || gotOutCompressed != 40 || gotInRaw != 80 || gotInCompressed != 30 {
+		t.Fatalf("CompressionStats() = (%d, %d, %d, %d), want (100, 40, 80, 30)",
+			gotOutRaw, gotOutCompressed, gotInRaw, gotInCompressed)
+	}
+}
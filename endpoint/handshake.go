@@ -0,0 +1,133 @@
+package endpoint
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+	mpro "github.com/weibocom/motan-go/protocol"
+)
+
+const (
+	// optionsRequestID is a reserved request id for the handshake "options" message.
+	// GenerateRequestID never returns this value; NewStream uses it only for a
+	// message whose request id is 0 and otherwise keeps the caller's own id. The
+	// handshake finishes before any Stream is created on the channel.
+	optionsRequestID = ^uint64(0)
+
+	defaultOptionsTimeout   = 2 * time.Second
+	defaultMaxMessageSize   = 8 * 1024 * 1024
+	motanOptionsProtocolV   = "2.0"
+	optionClusterHashKey    = "clusterHash"
+	optionMaxMessageSizeKey = "maxMessageSize"
+)
+
+// ErrClusterHash is returned when two peers' clusterHash handshake options
+// disagree, which usually means a client was misconfigured to talk to the
+// wrong cluster.
+var ErrClusterHash = fmt.Errorf("options exchange: cluster hash mismatch")
+
+// buildLocalOptions collects the handshake capabilities this endpoint advertises
+// to its peer: protocol version, supported compressors, max message size and
+// (optionally) a cluster-hash used to catch cross-cluster misconfiguration
+// early. No keepalive/heartbeat interval is advertised.
+func buildLocalOptions(url *motan.URL) map[string]string {
+	options := map[string]string{
+		"version":               motanOptionsProtocolV,
+		compressorsOptionKey:    supportedCompressors,
+		optionMaxMessageSizeKey: strconv.Itoa(int(url.GetIntValue(optionMaxMessageSizeKey, defaultMaxMessageSize))),
+	}
+	if clusterHash := url.GetParam(optionClusterHashKey, ""); clusterHash != "" {
+		options[optionClusterHashKey] = clusterHash
+	}
+	return options
+}
+
+// exchangeOptions performs the handshake: it writes myOptions to the peer and
+// blocks (with a short deadline) for the peer's own options, populating
+// c.myOptions/c.peerOptions. It must run before c.recv()/c.send() are started,
+// since it reads/writes the connection directly instead of going through the
+// Stream machinery those goroutines serve.
+//
+// This rides on the existing heartbeat framing (mpro.BuildHeartbeat) rather
+// than a dedicated options message type, since mpro (the protocol package)
+// is outside this change and a new wire message type isn't something this
+// package can add on its own. That means a peer that doesn't recognize the
+// options body just sees an ordinary heartbeat and replies with an empty
+// one, which decodeOptions turns into an empty map -- negotiation degrades
+// to "no options known" rather than failing, but only activates for real
+// against a peer that understands this same encoding.
+func (c *Channel) exchangeOptions(myOptions map[string]string) error {
+	c.optionsLock.Lock()
+	c.myOptions = myOptions
+	c.optionsLock.Unlock()
+
+	msg := mpro.BuildHeartbeat(optionsRequestID, mpro.Req)
+	msg.Body = encodeOptions(myOptions)
+	buf := msg.Encode()
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("send options failed: %s", err.Error())
+	}
+
+	type deadlineSetter interface {
+		SetReadDeadline(t time.Time) error
+	}
+	dc, ok := c.conn.(deadlineSetter)
+	if !ok {
+		// Without a deadline we can't safely read off c.bufRead here and still
+		// bound the wait: reading in a separate goroutine with our own timer
+		// would race with channel.recv() reading the same bufio.Reader once it
+		// starts. Treat the peer's options as unknown instead of risking a
+		// handshake that can hang buildChannel forever; an eventual reply will
+		// just be logged and dropped as an orphaned heartbeat by recv().
+		vlog.Warningln("options handshake: conn does not support read deadlines, skipping peer options")
+		return nil
+	}
+	dc.SetReadDeadline(time.Now().Add(defaultOptionsTimeout))
+	defer dc.SetReadDeadline(time.Time{})
+
+	peerMsg, err := mpro.DecodeFromReader(c.bufRead)
+	if err != nil {
+		return fmt.Errorf("recv options failed: %s", err.Error())
+	}
+	peerOptions := decodeOptions(peerMsg.Body)
+
+	if localHash, ok := myOptions[optionClusterHashKey]; ok {
+		if peerHash, ok := peerOptions[optionClusterHashKey]; ok && peerHash != localHash {
+			return ErrClusterHash
+		}
+	}
+
+	c.optionsLock.Lock()
+	c.peerOptions = peerOptions
+	c.optionsLock.Unlock()
+	return nil
+}
+
+func encodeOptions(options map[string]string) []byte {
+	var buf bytes.Buffer
+	for k, v := range options {
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(v)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func decodeOptions(body []byte) map[string]string {
+	options := make(map[string]string)
+	for _, line := range strings.Split(string(body), "\n") {
+		if line == "" {
+			continue
+		}
+		if idx := strings.IndexByte(line, '='); idx > 0 {
+			options[line[:idx]] = line[idx+1:]
+		}
+	}
+	return options
+}
@@ -0,0 +1,33 @@
+package endpoint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodeOptionsRoundTrip(t *testing.T) {
+	options := map[string]string{
+		"version":        motanOptionsProtocolV,
+		"compressors":    supportedCompressors,
+		"maxMessageSize": "8388608",
+	}
+	decoded := decodeOptions(encodeOptions(options))
+	if !reflect.DeepEqual(decoded, options) {
+		t.Fatalf("decodeOptions(encodeOptions(%v)) = %v", options, decoded)
+	}
+}
+
+func TestDecodeOptionsEmptyBody(t *testing.T) {
+	decoded := decodeOptions(nil)
+	if len(decoded) != 0 {
+		t.Fatalf("decodeOptions(nil) = %v, want empty map", decoded)
+	}
+}
+
+func TestDecodeOptionsIgnoresMalformedLines(t *testing.T) {
+	decoded := decodeOptions([]byte("version=2.0\nmalformed\n=noKey\nkey=value"))
+	want := map[string]string{"version": "2.0", "key": "value"}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Fatalf("decodeOptions(...) = %v, want %v", decoded, want)
+	}
+}
@@ -2,6 +2,8 @@ package endpoint
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -20,16 +22,62 @@ var (
 	defaultChannelPoolSize     = 3
 	defaultRequestTimeout      = 1000 * time.Millisecond
 	defaultConnectTimeout      = 1000 * time.Millisecond
-	defaultKeepaliveInterval   = 10 * time.Second
 	defaultErrorCountThreshold = 10
+	defaultReconnectBaseMs     = int64(20)
+	defaultReconnectMaxMs      = int64(30 * 1000)
+	defaultHighWaterStreams    = 500
+	defaultLowWaterStreams     = 50
+	defaultPoolIdleTimeout     = 5 * time.Minute
 	ErrChannelShutdown         = fmt.Errorf("The channel has been shutdown")
 	ErrSendRequestTimeout      = fmt.Errorf("Timeout err: send request timeout")
 	ErrRecvRequestTimeout      = fmt.Errorf("Timeout err: receive request timeout")
+	ErrStreamReset             = fmt.Errorf("stream has been reset")
 
 	idOffset            uint64 // id generator offset
 	defaultAsyncResonse = &motan.MotanResponse{Attachment: make(map[string]string, 0), RPCContext: &motan.RPCContext{AsyncCall: true}}
 )
 
+// exponentialBackoff produces increasing retry delays for the channel reconnect
+// and keepalive loops: it starts at baseMs, doubles on every Next() call and caps
+// at maxMs, so a long downstream outage doesn't thundering-herd every reconnect
+// tick. Reset brings it back to baseMs once a reconnect/heartbeat succeeds.
+type exponentialBackoff struct {
+	baseMs int64
+	maxMs  int64
+	index  uint
+}
+
+func newExponentialBackoff(baseMs, maxMs int64) *exponentialBackoff {
+	if baseMs <= 0 {
+		baseMs = defaultReconnectBaseMs
+	}
+	if maxMs <= 0 {
+		maxMs = defaultReconnectMaxMs
+	}
+	return &exponentialBackoff{baseMs: baseMs, maxMs: maxMs}
+}
+
+// Next returns the delay to wait before the next attempt and advances the backoff.
+func (b *exponentialBackoff) Next() time.Duration {
+	delay := b.maxMs
+	if shifted := b.baseMs << b.index; shifted > 0 && shifted < b.maxMs {
+		delay = shifted
+		b.index++
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+// Reset brings the backoff back to its base delay, e.g. after a successful reconnect.
+func (b *exponentialBackoff) Reset() {
+	b.index = 0
+}
+
+func (m *MotanEndpoint) reconnectBackoff() *exponentialBackoff {
+	baseMs := m.url.GetIntValue("reconnectBaseMs", defaultReconnectBaseMs)
+	maxMs := m.url.GetIntValue("reconnectMaxMs", defaultReconnectMaxMs)
+	return newExponentialBackoff(baseMs, maxMs)
+}
+
 type MotanEndpoint struct {
 	url        *motan.URL
 	channels   *ChannelPool
@@ -42,6 +90,13 @@ type MotanEndpoint struct {
 	// for heartbeat requestid
 	keepaliveID   uint64
 	serialization motan.Serialization
+
+	// tls transport, nil when the endpoint is plaintext
+	tlsConfig *tlsConfigProvider
+	tlsStopCh chan struct{}
+
+	// bytes_in/bytes_out pre- and post-compression
+	compression compressionStats
 }
 
 func (m *MotanEndpoint) setAvailable(available bool) {
@@ -61,26 +116,49 @@ func (m *MotanEndpoint) SetProxy(proxy bool) {
 func (m *MotanEndpoint) Initialize() {
 	m.destroyCh = make(chan struct{}, 1)
 	connectTimeout := m.url.GetTimeDuration("connectTimeout", time.Millisecond, defaultConnectTimeout)
+	addr := m.url.Host + ":" + strconv.Itoa((int)(m.url.Port))
 
 	factory := func() (net.Conn, error) {
-		return net.DialTimeout("tcp", m.url.Host+":"+strconv.Itoa((int)(m.url.Port)), connectTimeout)
+		return net.DialTimeout("tcp", addr, connectTimeout)
 	}
-	channels, err := NewChannelPool(defaultChannelPoolSize, factory, nil)
+	if tlsEnabled(m.url) {
+		tlsConfig, err := newTLSConfigProvider(m.url)
+		if err != nil {
+			vlog.Errorln("motan2 endpoint tls config init failed. ", err)
+		} else {
+			m.tlsConfig = tlsConfig
+			factory = func() (net.Conn, error) {
+				conn, err := net.DialTimeout("tcp", addr, connectTimeout)
+				if err != nil {
+					return nil, err
+				}
+				return tls.Client(conn, m.tlsConfig.getConfig()), nil
+			}
+			m.tlsStopCh = make(chan struct{})
+			go m.tlsConfig.watchCert(m.tlsStopCh)
+		}
+	}
+	channelConfig := &Config{RequestTimeout: defaultRequestTimeout, HandshakeOptions: buildLocalOptions(m.url)}
+	channels, err := NewDynamicChannelPool(m.url, factory, channelConfig)
 	if err != nil {
 		vlog.Errorln("Channel pool init failed. ", err)
-		// retry connect
+		// retry connect with exponential backoff, so a briefly unreachable
+		// downstream cluster doesn't get hit by every endpoint every 60s
 		go func() {
-			ticker := time.NewTicker(60 * time.Second)
-			defer ticker.Stop()
+			backoff := m.reconnectBackoff()
+			timer := time.NewTimer(backoff.Next())
+			defer timer.Stop()
 			for {
 				select {
-				case <-ticker.C:
-					channels, err := NewChannelPool(defaultChannelPoolSize, factory, nil)
+				case <-timer.C:
+					channels, err := NewDynamicChannelPool(m.url, factory, channelConfig)
 					if err == nil {
 						m.channels = channels
 						m.setAvailable(true)
+						backoff.Reset()
 						return
 					}
+					timer.Reset(backoff.Next())
 				case <-m.destroyCh:
 					return
 				}
@@ -95,6 +173,9 @@ func (m *MotanEndpoint) Initialize() {
 func (m *MotanEndpoint) Destroy() {
 	m.setAvailable(false)
 	m.destroyCh <- struct{}{}
+	if m.tlsStopCh != nil {
+		close(m.tlsStopCh)
+	}
 	if m.channels != nil {
 		vlog.Infof("motan2 endpoint %s will destroyed", m.url.GetAddressStr())
 		m.channels.Close()
@@ -138,7 +219,10 @@ func (m *MotanEndpoint) Call(request motan.Request) motan.Response {
 		vlog.Errorf("convert motan request fail! %s, err:%s\n", motan.GetReqInfo(request), err.Error())
 		return motan.BuildExceptionResponse(request.GetRequestID(), &motan.Exception{ErrCode: 500, ErrMsg: "convert motan request fail!", ErrType: motan.ServiceException})
 	}
-	recvMsg, err := channel.Call(msg, deadline, rc)
+	compressRequestBody(channel, msg, rc.GzipSize, &m.compression)
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+	recvMsg, err := channel.CallContext(ctx, msg, rc)
 	if err != nil {
 		vlog.Errorln("motanEndpoint error: ", err)
 		m.recordErrAndKeepalive()
@@ -149,6 +233,7 @@ func (m *MotanEndpoint) Call(request motan.Request) motan.Response {
 	if rc != nil && rc.AsyncCall {
 		return defaultAsyncResonse
 	}
+	decompressResponseBody(recvMsg, &m.compression)
 	recvMsg.Header.SetProxy(m.proxy)
 	response, err := mpro.ConvertToResponse(recvMsg, m.serialization)
 	if err != nil {
@@ -175,11 +260,12 @@ func (m *MotanEndpoint) resetErr() {
 }
 
 func (m *MotanEndpoint) keepalive() {
-	ticker := time.NewTicker(defaultKeepaliveInterval)
-	defer ticker.Stop()
+	backoff := m.reconnectBackoff()
+	timer := time.NewTimer(backoff.Next())
+	defer timer.Stop()
 	for {
 		select {
-		case <-ticker.C:
+		case <-timer.C:
 			m.keepaliveID++
 			vlog.Infof("[keepalive] send heartbeat... requestID=%d ", m.keepaliveID)
 			if channel, err := m.channels.Get(); err != nil {
@@ -188,11 +274,13 @@ func (m *MotanEndpoint) keepalive() {
 				_, error := channel.Call(mpro.BuildHeartbeat(m.keepaliveID, mpro.Req), defaultRequestTimeout, nil)
 				if error == nil {
 					m.setAvailable(true)
+					backoff.Reset()
 					vlog.Infof("heartbeat success.\n")
 					return
 				}
 				vlog.Infof("heartbeat failed. %v\n", err)
 			}
+			timer.Reset(backoff.Next())
 		case <-m.destroyCh:
 			return
 		}
@@ -233,6 +321,10 @@ func (m *MotanEndpoint) IsAvailable() bool {
 // Config : Config
 type Config struct {
 	RequestTimeout time.Duration
+
+	// HandshakeOptions, when non-nil, are sent to the peer as soon as a Channel's
+	// connection is established, before any RPC traffic flows on it.
+	HandshakeOptions map[string]string
 }
 
 func DefaultConfig() *Config {
@@ -266,6 +358,16 @@ type Channel struct {
 	heartbeats    map[uint64]*Stream
 	heartbeatLock sync.Mutex
 
+	// capability/options negotiated with the peer during the handshake
+	myOptions   map[string]string
+	peerOptions map[string]string
+	optionsLock sync.RWMutex
+
+	// idleSince is a UnixNano timestamp set whenever this channel's stream count
+	// drops to zero, so shrinkOnce can tell a genuinely idle channel from one
+	// that merely happens to be sampled between requests.
+	idleSince int64
+
 	// shutdown
 	shutdown     bool
 	shutdownErr  error
@@ -273,6 +375,38 @@ type Channel struct {
 	shutdownLock sync.Mutex
 }
 
+// markIdleIfEmpty records the current time as this channel's idleSince
+// whenever its last in-flight stream has just finished.
+func (c *Channel) markIdleIfEmpty() {
+	if c.StreamCount() == 0 {
+		atomic.StoreInt64(&c.idleSince, time.Now().UnixNano())
+	}
+}
+
+// idleSinceTime returns the time at which this channel's stream count last
+// dropped to zero.
+func (c *Channel) idleSinceTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.idleSince))
+}
+
+// PeerOption returns a handshake option advertised by the peer, e.g. "compressors"
+// or "maxMessageSize". ok is false if no handshake was performed or the peer didn't
+// set the key.
+func (c *Channel) PeerOption(key string) (string, bool) {
+	c.optionsLock.RLock()
+	defer c.optionsLock.RUnlock()
+	v, ok := c.peerOptions[key]
+	return v, ok
+}
+
+// MyOption returns a handshake option this endpoint advertised to the peer.
+func (c *Channel) MyOption(key string) (string, bool) {
+	c.optionsLock.RLock()
+	defer c.optionsLock.RUnlock()
+	v, ok := c.myOptions[key]
+	return v, ok
+}
+
 type Stream struct {
 	channel *Channel
 	sendMsg *mpro.Message
@@ -284,9 +418,16 @@ type Stream struct {
 	deadline        time.Time
 	originRequestID uint64
 	localRequestID  uint64
+	// resetCh is closed by Reset so a blocked Send/Recv unblocks immediately
+	// instead of waiting out the deadline timer
+	resetCh chan struct{}
 
-	rc      *motan.RPCContext
-	isClose bool
+	rc *motan.RPCContext
+
+	// closeLock guards isClose, which Close and Reset may both set from
+	// different goroutines (Recv's defer vs. CallContext's ctx.Done branch).
+	closeLock sync.Mutex
+	isClose   bool
 }
 
 func (s *Stream) Send() error {
@@ -297,14 +438,28 @@ func (s *Stream) Send() error {
 	buf := s.sendMsg.Encode()
 	s.sendMsg.Header.RequestID = s.originRequestID
 
-	ready := sendReady{data: buf.Bytes()}
+	// Encode already allocated this buffer, so there's nothing to gain by
+	// copying it into a separate pooled buffer before handing it to
+	// Channel.send -- that would just add a second allocation-sized memcpy on
+	// top of it. Hand the encoded bytes over as-is and return them to
+	// globalBufferPool once written. The send path never takes buffers from
+	// globalBufferPool: every Send still gets a fresh buffer from Encode.
+	encoded := buf.Bytes()
+	size := uint32(len(encoded))
+
+	ready := sendReady{data: encoded, size: size}
 	select {
 	case s.channel.sendCh <- ready:
 		return nil
 	case <-timer.C:
+		globalBufferPool.Put(size, encoded)
 		return ErrSendRequestTimeout
 	case <-s.channel.shutdownCh:
+		globalBufferPool.Put(size, encoded)
 		return ErrChannelShutdown
+	case <-s.resetCh:
+		globalBufferPool.Put(size, encoded)
+		return ErrStreamReset
 	}
 }
 
@@ -329,6 +484,8 @@ func (s *Stream) Recv() (*mpro.Message, error) {
 		return nil, ErrRecvRequestTimeout
 	case <-s.channel.shutdownCh:
 		return nil, ErrChannelShutdown
+	case <-s.resetCh:
+		return nil, ErrStreamReset
 	}
 }
 
@@ -337,6 +494,7 @@ func (s *Stream) notify(msg *mpro.Message) {
 		s.Close()
 	}()
 	if s.rc != nil && s.rc.AsyncCall {
+		decompressResponseBody(msg, nil)
 		msg.Header.SetProxy(s.rc.Proxy)
 		result := s.rc.Result
 		serialization := s.rc.ExtFactory.GetSerialization("", msg.Header.GetSerialize())
@@ -373,6 +531,7 @@ func (c *Channel) NewStream(msg *mpro.Message, rc *motan.RPCContext) (*Stream, e
 		channel:         c,
 		sendMsg:         msg,
 		recvNotifyCh:    make(chan struct{}, 1),
+		resetCh:         make(chan struct{}),
 		deadline:        time.Now().Add(1 * time.Second),
 		originRequestID: msg.Header.RequestID,
 		rc:              rc,
@@ -395,23 +554,71 @@ func (c *Channel) NewStream(msg *mpro.Message, rc *motan.RPCContext) (*Stream, e
 }
 
 func (s *Stream) Close() {
-	if !s.isClose {
-		s.channel.streamLock.Lock()
-		delete(s.channel.streams, s.sendMsg.Header.RequestID)
-		s.channel.streamLock.Unlock()
-		s.isClose = true
+	s.closeLock.Lock()
+	if s.isClose {
+		s.closeLock.Unlock()
+		return
+	}
+	s.isClose = true
+	s.closeLock.Unlock()
+
+	s.channel.streamLock.Lock()
+	delete(s.channel.streams, s.localRequestID)
+	s.channel.streamLock.Unlock()
+	s.channel.heartbeatLock.Lock()
+	delete(s.channel.heartbeats, s.localRequestID)
+	s.channel.heartbeatLock.Unlock()
+	s.channel.markIdleIfEmpty()
+}
+
+// Reset abandons the stream immediately: it removes it from the channel's
+// streams/heartbeats maps and wakes up any Send/Recv blocked on it, instead of
+// leaving them to hold their slot until the deadline timer fires. Call this when
+// the caller has already given up, e.g. its context was canceled.
+func (s *Stream) Reset() {
+	s.closeLock.Lock()
+	if s.isClose {
+		s.closeLock.Unlock()
+		return
 	}
+	s.isClose = true
+	s.closeLock.Unlock()
+
+	s.channel.streamLock.Lock()
+	delete(s.channel.streams, s.localRequestID)
+	s.channel.streamLock.Unlock()
+	s.channel.heartbeatLock.Lock()
+	delete(s.channel.heartbeats, s.localRequestID)
+	s.channel.heartbeatLock.Unlock()
+	s.channel.markIdleIfEmpty()
+	close(s.resetCh)
 }
 
 type sendReady struct {
 	data []byte
+	// size is len(data) when queued, used to pick the globalBufferPool bucket
+	// that data is returned to (its cap may exceed len)
+	size uint32
 }
 
 func (c *Channel) Call(msg *mpro.Message, deadline time.Duration, rc *motan.RPCContext) (*mpro.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+	return c.CallContext(ctx, msg, rc)
+}
+
+// CallContext behaves like Call but also gives up as soon as ctx is canceled,
+// resetting the stream so it doesn't keep occupying a slot in the channel's
+// streams map until its own deadline timer fires.
+func (c *Channel) CallContext(ctx context.Context, msg *mpro.Message, rc *motan.RPCContext) (*mpro.Message, error) {
 	stream, err := c.NewStream(msg, rc)
 	if err != nil {
 		return nil, err
 	}
+	deadline := defaultRequestTimeout
+	if dl, ok := ctx.Deadline(); ok {
+		deadline = time.Until(dl)
+	}
 	stream.SetDeadline(deadline)
 	if err := stream.Send(); err != nil {
 		return nil, err
@@ -419,7 +626,23 @@ func (c *Channel) Call(msg *mpro.Message, deadline time.Duration, rc *motan.RPCC
 	if rc != nil && rc.AsyncCall {
 		return nil, nil
 	}
-	return stream.Recv()
+
+	type recvResult struct {
+		msg *mpro.Message
+		err error
+	}
+	done := make(chan recvResult, 1)
+	go func() {
+		msg, err := stream.Recv()
+		done <- recvResult{msg, err}
+	}()
+	select {
+	case r := <-done:
+		return r.msg, r.err
+	case <-ctx.Done():
+		stream.Reset()
+		return nil, ctx.Err()
+	}
 }
 
 func (c *Channel) IsClosed() bool {
@@ -431,6 +654,19 @@ func (c *Channel) IsClosed() bool {
 	}
 }
 
+// StreamCount returns how many requests (including outstanding heartbeats) this
+// channel currently has in flight, used by ChannelPool to decide whether to grow
+// or shrink.
+func (c *Channel) StreamCount() int {
+	c.streamLock.Lock()
+	n := len(c.streams)
+	c.streamLock.Unlock()
+	c.heartbeatLock.Lock()
+	n += len(c.heartbeats)
+	c.heartbeatLock.Unlock()
+	return n
+}
+
 func (c *Channel) recv() {
 	if err := c.recvLoop(); err != nil {
 		c.closeOnErr(fmt.Errorf("%+v", err))
@@ -456,24 +692,62 @@ func (c *Channel) recvLoop() error {
 	}
 }
 
+// maxSendBatch bounds how many already-queued sendReady items get coalesced
+// into one writev-style write.
+const maxSendBatch = 16
+
 func (c *Channel) send() {
 	for {
 		select {
 		case ready := <-c.sendCh:
-			if ready.data != nil {
-				// TODO need async?
-				sent := 0
-				for sent < len(ready.data) {
-					n, err := c.conn.Write(ready.data[sent:])
-					if err != nil {
-						vlog.Errorf("Failed to write header: %v", err)
-						c.closeOnErr(err)
-						return
+			if ready.data == nil {
+				continue
+			}
+			batch := []sendReady{ready}
+		drain:
+			for len(batch) < maxSendBatch {
+				select {
+				case more := <-c.sendCh:
+					if more.data != nil {
+						batch = append(batch, more)
 					}
-					sent += n
+				default:
+					break drain
 				}
 			}
+			// coalesce whatever is already queued into a single write, which
+			// meaningfully cuts syscalls under the fan-in of many concurrent
+			// RPCs onto the channel pool
+			buffers := make(net.Buffers, len(batch))
+			for i, r := range batch {
+				buffers[i] = r.data
+			}
+			_, err := buffers.WriteTo(c.conn)
+			for _, r := range batch {
+				globalBufferPool.Put(r.size, r.data)
+			}
+			if err != nil {
+				vlog.Errorf("Failed to write header: %v", err)
+				c.closeOnErr(err)
+				return
+			}
 		case <-c.shutdownCh:
+			c.returnQueuedBuffers()
+			return
+		}
+	}
+}
+
+// returnQueuedBuffers drains any sendReady items still queued when the channel
+// shuts down, returning their buffers to globalBufferPool instead of leaking them.
+func (c *Channel) returnQueuedBuffers() {
+	for {
+		select {
+		case ready := <-c.sendCh:
+			if ready.data != nil {
+				globalBufferPool.Put(ready.size, ready.data)
+			}
+		default:
 			return
 		}
 	}
@@ -534,6 +808,15 @@ type ChannelPool struct {
 	channelsLock sync.Mutex
 	factory      ConnFactory
 	config       *Config
+
+	// dynamic sizing: fixed-size (original) behavior when minChannels == maxChannels
+	minChannels      int
+	maxChannels      int
+	highWaterStreams int
+	lowWaterStreams  int
+	idleTimeout      time.Duration
+	count            int32
+	shrinkStopCh     chan struct{}
 }
 
 func (c *ChannelPool) getChannels() chan *Channel {
@@ -556,15 +839,166 @@ func (c *ChannelPool) Get() (*Channel, error) {
 		}
 		channel = buildChannel(conn, c.config)
 	}
+	hot := channel != nil && channel.StreamCount() > c.highWaterStreams
 	if err := retChannelPool(channels, channel); err != nil && channel != nil {
 		channel.closeOnErr(err)
 	}
+	if hot {
+		// Dialing a new channel (plus its handshake) can take up to the
+		// options timeout; run growth off this request's path so the caller
+		// that tripped highWaterStreams isn't the one stuck waiting on it.
+		go c.maybeGrow()
+	}
 	if channel == nil {
 		return nil, errors.New("channel is nil")
 	}
 	return channel, nil
 }
 
+// maybeGrow adds one more channel to the pool when every pooled channel is
+// running hot (above highWaterStreams) and the pool hasn't hit maxChannels
+// yet, so a downstream method with occasional multi-second latency doesn't
+// make unrelated requests queue behind it on a fixed-size pool. It runs in
+// its own goroutine kicked off by Get(), so the dial (and handshake) it may
+// do never adds latency to the request that tripped the check.
+func (c *ChannelPool) maybeGrow() {
+	if c.maxChannels <= c.minChannels {
+		return
+	}
+	if int(atomic.LoadInt32(&c.count)) >= c.maxChannels {
+		return
+	}
+	channels := c.getChannels()
+	if channels == nil {
+		return
+	}
+
+	// Drain the currently-queued channels (non-blockingly, so an
+	// empty/smaller-than-expected queue doesn't stall) and require every one
+	// of them to be hot. A nil channel can't be known to be hot, so treat it
+	// as cold and skip growing.
+	n := int(atomic.LoadInt32(&c.count))
+	drained := make([]*Channel, 0, n)
+	allHot := true
+	for i := 0; i < n; i++ {
+		select {
+		case ch := <-channels:
+			drained = append(drained, ch)
+			if ch == nil || ch.StreamCount() <= c.highWaterStreams {
+				allHot = false
+			}
+		default:
+		}
+	}
+	if len(drained) == 0 {
+		return
+	}
+	for _, ch := range drained {
+		select {
+		case channels <- ch:
+		default:
+			if ch != nil {
+				ch.Close()
+			}
+			atomic.AddInt32(&c.count, -1)
+		}
+	}
+	if !allHot {
+		return
+	}
+
+	conn, err := c.factory()
+	if err != nil {
+		vlog.Errorln("grow channel pool failed.", err)
+		return
+	}
+	channel := buildChannel(conn, c.config)
+	if channel == nil {
+		return
+	}
+	select {
+	case channels <- channel:
+		n := atomic.AddInt32(&c.count, 1)
+		vlog.Infof("channel pool grew to %d channels\n", n)
+	default:
+		channel.Close()
+	}
+}
+
+// shrinkLoop periodically closes idle channels once the pool has grown beyond
+// minChannels and average in-flight streams has dropped below lowWaterStreams.
+func (c *ChannelPool) shrinkLoop() {
+	ticker := time.NewTicker(c.idleTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.shrinkOnce()
+		case <-c.shrinkStopCh:
+			return
+		}
+	}
+}
+
+func (c *ChannelPool) shrinkOnce() {
+	n := int(atomic.LoadInt32(&c.count))
+	if n <= c.minChannels {
+		return
+	}
+	channels := c.getChannels()
+	if channels == nil {
+		return
+	}
+	drained := make([]*Channel, 0, n)
+	totalStreams := 0
+	for i := 0; i < n; i++ {
+		select {
+		case ch := <-channels:
+			drained = append(drained, ch)
+			if ch != nil {
+				totalStreams += ch.StreamCount()
+			}
+		default:
+		}
+	}
+	if len(drained) == 0 {
+		return
+	}
+
+	// The pool average only tells us whether it's over-provisioned; it must
+	// never pick which channel to close, since a channel with many in-flight
+	// streams would have every one of those requests fail with
+	// ErrChannelShutdown. Only close a channel that is itself idle (no
+	// in-flight streams) and has been idle for at least idleTimeout.
+	shouldShrink := len(drained) > c.minChannels && totalStreams/len(drained) < c.lowWaterStreams
+	closeIdx := -1
+	if shouldShrink {
+		now := time.Now()
+		for i, ch := range drained {
+			if ch != nil && ch.StreamCount() == 0 && now.Sub(ch.idleSinceTime()) >= c.idleTimeout {
+				closeIdx = i
+				break
+			}
+		}
+	}
+	for i, ch := range drained {
+		if i == closeIdx {
+			vlog.Infoln("channel pool shrinking, closing an idle channel")
+			ch.Close()
+			atomic.AddInt32(&c.count, -1)
+			continue
+		}
+		select {
+		case channels <- ch:
+		default:
+			if ch != nil {
+				ch.Close()
+			}
+			atomic.AddInt32(&c.count, -1)
+		}
+	}
+}
+
 func retChannelPool(channels chan *Channel, channel *Channel) (error error) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -585,6 +1019,9 @@ func (c *ChannelPool) Close() error {
 	c.factory = nil
 	c.config = nil
 	c.channelsLock.Unlock()
+	if c.shrinkStopCh != nil {
+		close(c.shrinkStopCh)
+	}
 	if channels == nil {
 		return nil
 	}
@@ -597,22 +1034,57 @@ func (c *ChannelPool) Close() error {
 	return nil
 }
 
+// NewChannelPool builds a fixed-size pool of poolCap channels; poolCap acts as
+// both minChannels and maxChannels, so the pool never grows or shrinks.
 func NewChannelPool(poolCap int, factory ConnFactory, config *Config) (*ChannelPool, error) {
-	if poolCap <= 0 {
+	return newChannelPool(poolCap, poolCap, defaultHighWaterStreams, defaultLowWaterStreams, defaultPoolIdleTimeout, factory, config)
+}
+
+// NewDynamicChannelPool builds a pool whose size is driven by in-flight stream
+// pressure: it grows up to maxChannels when every pooled channel is running hot
+// (more than highWaterStreams outstanding streams) and shrinks idle channels
+// back down to minChannels after idleTimeout once average load drops below
+// lowWaterStreams. minChannels == maxChannels behaves exactly like NewChannelPool.
+func NewDynamicChannelPool(url *motan.URL, factory ConnFactory, config *Config) (*ChannelPool, error) {
+	minChannels := int(url.GetIntValue("minChannels", int64(defaultChannelPoolSize)))
+	maxChannels := int(url.GetIntValue("maxChannels", int64(defaultChannelPoolSize)))
+	highWaterStreams := int(url.GetIntValue("highWaterStreams", int64(defaultHighWaterStreams)))
+	lowWaterStreams := int(url.GetIntValue("lowWaterStreams", int64(defaultLowWaterStreams)))
+	idleTimeout := url.GetTimeDuration("idleTimeout", time.Second, defaultPoolIdleTimeout)
+	return newChannelPool(minChannels, maxChannels, highWaterStreams, lowWaterStreams, idleTimeout, factory, config)
+}
+
+func newChannelPool(minChannels, maxChannels, highWaterStreams, lowWaterStreams int, idleTimeout time.Duration, factory ConnFactory, config *Config) (*ChannelPool, error) {
+	if minChannels <= 0 || maxChannels < minChannels {
 		return nil, errors.New("invalid capacity settings")
 	}
 	channelPool := &ChannelPool{
-		channels: make(chan *Channel, poolCap),
-		factory:  factory,
-		config:   config,
+		channels:         make(chan *Channel, maxChannels),
+		factory:          factory,
+		config:           config,
+		minChannels:      minChannels,
+		maxChannels:      maxChannels,
+		highWaterStreams: highWaterStreams,
+		lowWaterStreams:  lowWaterStreams,
+		idleTimeout:      idleTimeout,
 	}
-	for i := 0; i < poolCap; i++ {
+	for i := 0; i < minChannels; i++ {
 		conn, err := factory()
 		if err != nil {
 			channelPool.Close()
 			return nil, errors.New("channel pool init failed")
 		}
-		channelPool.channels <- buildChannel(conn, config)
+		channel := buildChannel(conn, config)
+		if channel == nil {
+			channelPool.Close()
+			return nil, errors.New("channel pool init failed")
+		}
+		channelPool.channels <- channel
+		channelPool.count++
+	}
+	if maxChannels > minChannels {
+		channelPool.shrinkStopCh = make(chan struct{})
+		go channelPool.shrinkLoop()
 	}
 	return channelPool, nil
 }
@@ -635,6 +1107,22 @@ func buildChannel(conn net.Conn, config *Config) *Channel {
 		streams:    make(map[uint64]*Stream, 64),
 		heartbeats: make(map[uint64]*Stream),
 		shutdownCh: make(chan struct{}),
+		idleSince:  time.Now().UnixNano(),
+	}
+
+	if config.HandshakeOptions != nil {
+		if err := channel.exchangeOptions(config.HandshakeOptions); err != nil {
+			// A cluster hash mismatch means this channel is talking to the wrong
+			// peer entirely, so it can never be usable. Any other handshake error
+			// (timeout, a peer too old to answer the options frame, ...) just
+			// means the negotiated capabilities are unknown; fall back to
+			// defaults and let the channel serve requests normally.
+			if errors.Is(err, ErrClusterHash) {
+				channel.closeOnErr(err)
+				return nil
+			}
+			vlog.Warningf("options handshake failed, continuing without negotiated capabilities: %v\n", err)
+		}
 	}
 
 	go channel.recv()
@@ -0,0 +1,206 @@
+package endpoint
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// nopConn is a minimal net.Conn stand-in for pool tests that only need
+// Channel.Close to have something to call without touching real I/O.
+type nopConn struct{}
+
+func (nopConn) Read([]byte) (int, error)         { return 0, nil }
+func (nopConn) Write(p []byte) (int, error)      { return len(p), nil }
+func (nopConn) Close() error                     { return nil }
+func (nopConn) LocalAddr() net.Addr              { return nil }
+func (nopConn) RemoteAddr() net.Addr             { return nil }
+func (nopConn) SetDeadline(time.Time) error      { return nil }
+func (nopConn) SetReadDeadline(time.Time) error  { return nil }
+func (nopConn) SetWriteDeadline(time.Time) error { return nil }
+
+// newTestPoolChannel builds a Channel with streamCount in-flight streams,
+// usable as a ChannelPool test fixture without a real connection.
+func newTestPoolChannel(streamCount int) *Channel {
+	c := &Channel{
+		conn:       nopConn{},
+		streams:    make(map[uint64]*Stream, streamCount),
+		heartbeats: make(map[uint64]*Stream),
+		shutdownCh: make(chan struct{}),
+		idleSince:  time.Now().UnixNano(),
+	}
+	for i := 0; i < streamCount; i++ {
+		c.streams[uint64(i)] = &Stream{}
+	}
+	return c
+}
+
+func TestMaybeGrowSkipsWhenNotAllChannelsHot(t *testing.T) {
+	pool := &ChannelPool{
+		channels: make(chan *Channel, 4),
+		factory: func() (net.Conn, error) {
+			t.Fatal("factory must not be called unless every pooled channel is hot")
+			return nil, nil
+		},
+		config:           DefaultConfig(),
+		minChannels:      1,
+		maxChannels:      4,
+		highWaterStreams: 2,
+		count:            2,
+	}
+	pool.channels <- newTestPoolChannel(5) // hot
+	pool.channels <- newTestPoolChannel(0) // cold
+	pool.maybeGrow()
+	if got := int(atomic.LoadInt32(&pool.count)); got != 2 {
+		t.Fatalf("count = %d, want 2 (pool must not grow when a channel is cold)", got)
+	}
+	if got := len(pool.channels); got != 2 {
+		t.Fatalf("channels requeued = %d, want 2", got)
+	}
+}
+
+func TestMaybeGrowDialsWhenAllChannelsHot(t *testing.T) {
+	var dialed int32
+	var peers []net.Conn
+	pool := &ChannelPool{
+		channels: make(chan *Channel, 4),
+		factory: func() (net.Conn, error) {
+			atomic.AddInt32(&dialed, 1)
+			client, server := net.Pipe()
+			peers = append(peers, server)
+			return client, nil
+		},
+		config:           DefaultConfig(),
+		minChannels:      1,
+		maxChannels:      4,
+		highWaterStreams: 2,
+		count:            1,
+	}
+	pool.channels <- newTestPoolChannel(5) // hot
+	pool.maybeGrow()
+	if got := atomic.LoadInt32(&dialed); got != 1 {
+		t.Fatalf("factory dialed %d times, want 1", got)
+	}
+	if got := int(atomic.LoadInt32(&pool.count)); got != 2 {
+		t.Fatalf("count = %d, want 2 after growing", got)
+	}
+	if got := len(pool.channels); got != 2 {
+		t.Fatalf("channels in pool = %d, want 2 after growing", got)
+	}
+	for len(pool.channels) > 0 {
+		(<-pool.channels).Close()
+	}
+	for _, p := range peers {
+		p.Close()
+	}
+}
+
+func TestMaybeGrowStopsAtMaxChannels(t *testing.T) {
+	pool := &ChannelPool{
+		channels: make(chan *Channel, 4),
+		factory: func() (net.Conn, error) {
+			t.Fatal("factory must not be called once the pool is at maxChannels")
+			return nil, nil
+		},
+		config:           DefaultConfig(),
+		minChannels:      1,
+		maxChannels:      1,
+		highWaterStreams: 2,
+		count:            1,
+	}
+	pool.channels <- newTestPoolChannel(5) // hot
+	pool.maybeGrow()
+	if got := int(atomic.LoadInt32(&pool.count)); got != 1 {
+		t.Fatalf("count = %d, want 1 (maxChannels == minChannels must never grow)", got)
+	}
+}
+
+func TestShrinkOnceClosesOnlyTheIdleChannel(t *testing.T) {
+	pool := &ChannelPool{
+		channels:        make(chan *Channel, 4),
+		minChannels:     1,
+		lowWaterStreams: 10,
+		idleTimeout:     0,
+		count:           2,
+	}
+	busy := newTestPoolChannel(3)
+	idle := newTestPoolChannel(0)
+	idle.idleSince = time.Now().Add(-time.Hour).UnixNano()
+	pool.channels <- busy
+	pool.channels <- idle
+
+	pool.shrinkOnce()
+
+	if got := int(atomic.LoadInt32(&pool.count)); got != 1 {
+		t.Fatalf("count = %d, want 1 after shrinking the idle channel", got)
+	}
+	select {
+	case ch := <-pool.channels:
+		if ch != busy {
+			t.Fatalf("remaining pooled channel is not the busy one")
+		}
+		if ch.IsClosed() {
+			t.Fatalf("shrinkOnce closed the busy channel")
+		}
+	default:
+		t.Fatalf("expected the busy channel to remain queued")
+	}
+}
+
+func TestShrinkOnceLeavesPoolAloneWithNoIdleChannel(t *testing.T) {
+	pool := &ChannelPool{
+		channels:        make(chan *Channel, 4),
+		minChannels:     1,
+		lowWaterStreams: 10,
+		idleTimeout:     time.Hour,
+		count:           2,
+	}
+	a := newTestPoolChannel(0)
+	b := newTestPoolChannel(0)
+	pool.channels <- a
+	pool.channels <- b
+
+	pool.shrinkOnce()
+
+	if got := int(atomic.LoadInt32(&pool.count)); got != 2 {
+		t.Fatalf("count = %d, want 2 (neither channel has been idle for idleTimeout yet)", got)
+	}
+}
+
+func TestExponentialBackoffNext(t *testing.T) {
+	b := newExponentialBackoff(100, 1000)
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		1000 * time.Millisecond,
+		1000 * time.Millisecond,
+	}
+	for i, w := range want {
+		if got := b.Next(); got != w {
+			t.Fatalf("Next() #%d = %v, want %v", i, got, w)
+		}
+	}
+}
+
+func TestExponentialBackoffReset(t *testing.T) {
+	b := newExponentialBackoff(100, 1000)
+	b.Next()
+	b.Next()
+	b.Reset()
+	if got, want := b.Next(), 100*time.Millisecond; got != want {
+		t.Fatalf("Next() after Reset() = %v, want %v", got, want)
+	}
+}
+
+func TestNewExponentialBackoffDefaults(t *testing.T) {
+	b := newExponentialBackoff(0, 0)
+	if b.baseMs != defaultReconnectBaseMs {
+		t.Errorf("baseMs = %d, want default %d", b.baseMs, defaultReconnectBaseMs)
+	}
+	if b.maxMs != defaultReconnectMaxMs {
+		t.Errorf("maxMs = %d, want default %d", b.maxMs, defaultReconnectMaxMs)
+	}
+}
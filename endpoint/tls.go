@@ -0,0 +1,131 @@
+package endpoint
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	motan "github.com/weibocom/motan-go/core"
+	"github.com/weibocom/motan-go/log"
+)
+
+const (
+	tlsEnableKey             = "tls"
+	tlsCertFileKey           = "tlsCertFile"
+	tlsKeyFileKey            = "tlsKeyFile"
+	tlsCAFileKey             = "tlsCAFile"
+	tlsServerNameKey         = "tlsServerName"
+	tlsInsecureSkipVerifyKey = "tlsInsecureSkipVerify"
+
+	defaultCertWatchInterval = 30 * time.Second
+)
+
+// tlsConfigProvider builds a *tls.Config from an endpoint's URL params and,
+// when a client certificate is configured, watches the cert file's mtime so
+// long-lived endpoints pick up renewed short-lived certs without a restart.
+type tlsConfigProvider struct {
+	url *motan.URL
+
+	mux       sync.RWMutex
+	config    *tls.Config
+	certMtime time.Time
+}
+
+func tlsEnabled(url *motan.URL) bool {
+	return url.GetBoolValue(tlsEnableKey, false)
+}
+
+func newTLSConfigProvider(url *motan.URL) (*tlsConfigProvider, error) {
+	p := &tlsConfigProvider{url: url}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *tlsConfigProvider) reload() error {
+	serverName := p.url.GetParam(tlsServerNameKey, "")
+	if serverName == "" {
+		serverName = p.url.Host
+	}
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: p.url.GetBoolValue(tlsInsecureSkipVerifyKey, false),
+	}
+
+	var certMtime time.Time
+	certFile := p.url.GetParam(tlsCertFileKey, "")
+	keyFile := p.url.GetParam(tlsKeyFileKey, "")
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("load tls client cert failed: %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+		if info, err := os.Stat(certFile); err == nil {
+			certMtime = info.ModTime()
+		}
+	}
+
+	if caFile := p.url.GetParam(tlsCAFileKey, ""); caFile != "" {
+		caBytes, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("read tls ca file failed: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return fmt.Errorf("parse tls ca file failed: %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	p.mux.Lock()
+	p.config = config
+	p.certMtime = certMtime
+	p.mux.Unlock()
+	return nil
+}
+
+func (p *tlsConfigProvider) getConfig() *tls.Config {
+	p.mux.RLock()
+	defer p.mux.RUnlock()
+	return p.config
+}
+
+// watchCert polls the client cert file's mtime and reloads the tls.Config when
+// it changes, so a rotated short-lived cert is picked up without an endpoint restart.
+func (p *tlsConfigProvider) watchCert(stopCh <-chan struct{}) {
+	certFile := p.url.GetParam(tlsCertFileKey, "")
+	if certFile == "" {
+		return
+	}
+	ticker := time.NewTicker(defaultCertWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(certFile)
+			if err != nil {
+				vlog.Warningf("stat tls cert file failed: %v\n", err)
+				continue
+			}
+			p.mux.RLock()
+			changed := info.ModTime().After(p.certMtime)
+			p.mux.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := p.reload(); err != nil {
+				vlog.Errorf("reload tls config failed: %v\n", err)
+			} else {
+				vlog.Infoln("tls client cert rotated, reloaded config")
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}